@@ -0,0 +1,141 @@
+package httpaccesslog
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const clientIPContextKey contextKey = iota
+
+// ProxyHeaders lets AccessLogger resolve the real client IP of a request
+// that arrived through one or more reverse proxies, honoring (in order of
+// preference) the RFC 7239 Forwarded header, X-Forwarded-For and
+// X-Real-IP. Headers are only trusted when r.RemoteAddr falls inside one of
+// TrustedProxies; otherwise AccessLogger falls back to the host part of
+// r.RemoteAddr, with any port stripped.
+type ProxyHeaders struct {
+	TrustedProxies []*net.IPNet
+}
+
+func (this ProxyHeaders) trusts(ip net.IP) bool {
+	for _, network := range this.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithProxyHeaders returns a copy of this AccessLogger that resolves the
+// logged client IP through proxyHeaders when the request's immediate peer
+// is trusted.
+func (this AccessLogger) WithProxyHeaders(proxyHeaders ProxyHeaders) AccessLogger {
+	this.proxyHeaders = &proxyHeaders
+	return this
+}
+
+// ClientIPFromContext returns the client IP AccessLogger resolved for the
+// request carrying ctx, as stashed by Handle/HandleReturn. It returns "" if
+// the request wasn't wrapped by an AccessLogger.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey).(string)
+	return ip
+}
+
+// clientIP resolves the IP to log and hand to downstream handlers for r,
+// consulting this AccessLogger's ProxyHeaders (if any) only when r's
+// immediate peer is a trusted proxy.
+func (this AccessLogger) clientIP(r *http.Request) string {
+	peerHost, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peerHost = r.RemoteAddr
+	}
+
+	if this.proxyHeaders == nil {
+		return peerHost
+	}
+	peerIP := net.ParseIP(peerHost)
+	if peerIP == nil || !this.proxyHeaders.trusts(peerIP) {
+		return peerHost
+	}
+
+	if forwarded := r.Header.Get("Forwarded"); forwarded != "" {
+		if ip := this.proxyHeaders.rightmostUntrustedForwarded(forwarded); ip != "" {
+			return ip
+		}
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		if ip := this.proxyHeaders.rightmostUntrusted(xff); ip != "" {
+			return ip
+		}
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	return peerHost
+}
+
+// forwardedElementFor extracts the for= directive's address from a single
+// RFC 7239 forwarded-element, e.g. `for=192.0.2.60;proto=http;by=...` or
+// `for="[2001:db8:cafe::17]:4711"`, returning its host with any port and
+// brackets stripped.
+func forwardedElementFor(element string) string {
+	for _, directive := range strings.Split(element, ";") {
+		directive = strings.TrimSpace(directive)
+		name, value, found := strings.Cut(directive, "=")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "for") {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if host, _, err := net.SplitHostPort(value); err == nil {
+			return strings.Trim(host, "[]")
+		}
+		return strings.Trim(value, "[]")
+	}
+	return ""
+}
+
+// rightmostUntrustedForwarded walks a comma-separated RFC 7239 Forwarded
+// header from right to left, the same way rightmostUntrusted walks
+// X-Forwarded-For, skipping for= addresses added by trusted proxies and
+// returning the first one that isn't - the leftmost hop is exactly the one
+// an attacker controls, so it must never be trusted outright.
+func (this ProxyHeaders) rightmostUntrustedForwarded(forwarded string) string {
+	elements := strings.Split(forwarded, ",")
+	for i := len(elements) - 1; i >= 0; i-- {
+		candidate := forwardedElementFor(strings.TrimSpace(elements[i]))
+		if candidate == "" {
+			continue
+		}
+		ip := net.ParseIP(candidate)
+		if ip == nil {
+			continue
+		}
+		if !this.trusts(ip) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// rightmostUntrusted walks a comma-separated X-Forwarded-For list from right
+// to left, skipping entries added by trusted proxies, and returns the first
+// one that isn't - the earliest hop our trusted proxies can't vouch for.
+func (this ProxyHeaders) rightmostUntrusted(xff string) string {
+	hops := strings.Split(xff, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		candidate := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(candidate)
+		if ip == nil {
+			continue
+		}
+		if !this.trusts(ip) {
+			return candidate
+		}
+	}
+	return ""
+}
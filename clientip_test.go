@@ -0,0 +1,122 @@
+package httpaccesslog
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func mustParseCIDR(t *testing.T, cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("failed to parse CIDR %q: %v", cidr, err)
+	}
+	return network
+}
+
+func TestClientIPWithoutProxyHeadersUsesRemoteAddr(t *testing.T) {
+	accessLogger := New(nil)
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "[::1]:1234"
+	request.Header.Set("X-Forwarded-For", "203.0.113.5")
+
+	if ip := accessLogger.clientIP(request); ip != "::1" {
+		t.Errorf("expected ::1, got %q", ip)
+	}
+}
+
+func TestClientIPUntrustedPeerIgnoresHeaders(t *testing.T) {
+	accessLogger := New(nil).WithProxyHeaders(ProxyHeaders{
+		TrustedProxies: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "203.0.113.9:1234"
+	request.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	if ip := accessLogger.clientIP(request); ip != "203.0.113.9" {
+		t.Errorf("expected untrusted peer's own address 203.0.113.9, got %q", ip)
+	}
+}
+
+func TestClientIPTrustedPeerUsesXForwardedFor(t *testing.T) {
+	accessLogger := New(nil).WithProxyHeaders(ProxyHeaders{
+		TrustedProxies: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.5:1234"
+	request.Header.Set("X-Forwarded-For", "198.51.100.1, 10.0.0.2")
+
+	if ip := accessLogger.clientIP(request); ip != "198.51.100.1" {
+		t.Errorf("expected rightmost-untrusted 198.51.100.1, got %q", ip)
+	}
+}
+
+func TestClientIPTrustedPeerPrefersForwarded(t *testing.T) {
+	accessLogger := New(nil).WithProxyHeaders(ProxyHeaders{
+		TrustedProxies: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.5:1234"
+	request.Header.Set("Forwarded", `for="[2001:db8:cafe::17]:4711";proto=https`)
+	request.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	if ip := accessLogger.clientIP(request); ip != "2001:db8:cafe::17" {
+		t.Errorf("expected Forwarded for= to take precedence, got %q", ip)
+	}
+}
+
+func TestClientIPTrustedPeerForwardedSkipsTrustedHops(t *testing.T) {
+	accessLogger := New(nil).WithProxyHeaders(ProxyHeaders{
+		TrustedProxies: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.5:1234"
+	request.Header.Set("Forwarded", `for=6.6.6.6, for=10.0.0.5`)
+
+	if ip := accessLogger.clientIP(request); ip != "6.6.6.6" {
+		t.Errorf("expected the rightmost untrusted hop 6.6.6.6, got %q", ip)
+	}
+}
+
+func TestClientIPTrustedPeerForwardedDoesNotTrustLeftmostHop(t *testing.T) {
+	accessLogger := New(nil).WithProxyHeaders(ProxyHeaders{
+		TrustedProxies: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.5:1234"
+	request.Header.Set("Forwarded", `for=10.0.0.9, for=6.6.6.6, for=10.0.0.5`)
+
+	if ip := accessLogger.clientIP(request); ip != "6.6.6.6" {
+		t.Errorf("expected the rightmost untrusted hop 6.6.6.6 rather than the leftmost attacker-controlled one, got %q", ip)
+	}
+}
+
+func TestClientIPTrustedPeerFallsBackToXRealIP(t *testing.T) {
+	accessLogger := New(nil).WithProxyHeaders(ProxyHeaders{
+		TrustedProxies: []*net.IPNet{mustParseCIDR(t, "10.0.0.0/8")},
+	})
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.5:1234"
+	request.Header.Set("X-Real-IP", "198.51.100.7")
+
+	if ip := accessLogger.clientIP(request); ip != "198.51.100.7" {
+		t.Errorf("expected X-Real-IP 198.51.100.7, got %q", ip)
+	}
+}
+
+func TestClientIPFromContext(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := New(target)
+	var seen string
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "203.0.113.9:1234"
+
+	accessLogger.Handle(func(w http.ResponseWriter, r *http.Request) {
+		seen = ClientIPFromContext(r.Context())
+	})(blackHole{}, request)
+
+	if seen != "203.0.113.9" {
+		t.Errorf("expected handler to see client IP via context, got %q", seen)
+	}
+}
@@ -0,0 +1,236 @@
+package httpaccesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessLogEntry holds every value a Formatter might want to render for a
+// single request/response pair. ApacheCombinedFormatter only uses a subset
+// of these fields (not RequestID or Extra); Extra carries whatever
+// additional Fields were produced by the AccessLogger's registered
+// FieldExtractors.
+type AccessLogEntry struct {
+	RemoteAddr       string
+	Username         string
+	DateTime         time.Time
+	Method           string
+	Path             string
+	Proto            string
+	StatusCode       int
+	BodyBytes        int
+	RequestTime      time.Duration
+	UpstreamTime     time.Duration
+	Referer          string
+	UserAgent        string
+	CompressionRatio float64
+	RequestID        string
+	Error            string
+	Extra            []Field
+}
+
+// Field is a single named value contributed by a FieldExtractor, such as the
+// negotiated TLS version, a response header, or a trace ID pulled from the
+// request context.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// FieldExtractor derives an additional Field from a finished request. It
+// runs after the wrapped handler returns, so it can inspect response
+// headers written through w as well as the request.
+type FieldExtractor func(r *http.Request, w http.ResponseWriter) Field
+
+// Formatter renders an AccessLogEntry into the line that AccessLogger
+// writes out. Register one with AccessLogger.WithFormatter.
+type Formatter interface {
+	Format(entry AccessLogEntry) string
+}
+
+// ApacheCombinedFormatter renders the Apache "combined" log format. It is
+// the default used by AccessLogger when no other Formatter is set.
+type ApacheCombinedFormatter struct{}
+
+func (ApacheCombinedFormatter) Format(entry AccessLogEntry) string {
+	username := entry.Username
+	if username == "" {
+		username = "-"
+	}
+	referer := entry.Referer
+	if referer == "" {
+		referer = "-"
+	}
+	userAgent := entry.UserAgent
+	if userAgent == "" {
+		userAgent = "-"
+	}
+	compressionRatioStr := "-"
+	if entry.CompressionRatio > 0 {
+		compressionRatioStr = strconv.FormatFloat(entry.CompressionRatio, 'f', 2, 64)
+	}
+	requestSeconds := strconv.FormatFloat(entry.RequestTime.Seconds(), 'f', 3, 64)
+	upstreamSeconds := strconv.FormatFloat(entry.UpstreamTime.Seconds(), 'f', 3, 64)
+	errorStr := "-"
+	if entry.Error != "" {
+		errorStr = singleLine(entry.Error)
+	}
+	return fmt.Sprintf(
+		"%s - %s [%s] \"%s %s %s\" %d %d %s/%s \"%s\" \"%s\" %s %s",
+		entry.RemoteAddr,
+		username,
+		entry.DateTime.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method,
+		entry.Path,
+		entry.Proto,
+		entry.StatusCode,
+		entry.BodyBytes,
+		requestSeconds,
+		upstreamSeconds,
+		referer,
+		userAgent,
+		compressionRatioStr,
+		errorStr,
+	)
+}
+
+// singleLine collapses a multi-line error (e.g. one carrying a panic stack
+// trace) into something that fits on a single access log line.
+func singleLine(s string) string {
+	return strings.ReplaceAll(s, "\n", " | ")
+}
+
+// JSONFormatter renders one JSON object per request, with typed fields for
+// the values most log pipelines (Loki, ELK, ...) key off, plus whatever
+// extra Fields were registered on the AccessLogger.
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(entry AccessLogEntry) string {
+	fields := map[string]interface{}{
+		"time":          entry.DateTime.Format(time.RFC3339Nano),
+		"remote_ip":     entry.RemoteAddr,
+		"username":      entry.Username,
+		"method":        entry.Method,
+		"path":          entry.Path,
+		"proto":         entry.Proto,
+		"status":        entry.StatusCode,
+		"bytes":         entry.BodyBytes,
+		"request_time":  entry.RequestTime.Seconds(),
+		"upstream_time": entry.UpstreamTime.Seconds(),
+		"referer":       entry.Referer,
+		"user_agent":    entry.UserAgent,
+	}
+	if entry.CompressionRatio > 0 {
+		fields["compression_ratio"] = entry.CompressionRatio
+	}
+	if entry.RequestID != "" {
+		fields["request_id"] = entry.RequestID
+	}
+	if entry.Error != "" {
+		fields["error"] = entry.Error
+	}
+	for _, field := range entry.Extra {
+		fields[field.Name] = field.Value
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Sprintf(`{"marshal_error":%q}`, err.Error())
+	}
+	return string(encoded)
+}
+
+// LogfmtFormatter renders a request as a sequence of key=value pairs, the
+// format consumed by tools like Grafana Loki without a custom parser.
+type LogfmtFormatter struct{}
+
+func (LogfmtFormatter) Format(entry AccessLogEntry) string {
+	type pair struct {
+		key   string
+		value interface{}
+	}
+	pairs := []pair{
+		{"time", entry.DateTime.Format(time.RFC3339Nano)},
+		{"remote_ip", entry.RemoteAddr},
+		{"username", entry.Username},
+		{"method", entry.Method},
+		{"path", entry.Path},
+		{"proto", entry.Proto},
+		{"status", entry.StatusCode},
+		{"bytes", entry.BodyBytes},
+		{"request_time", entry.RequestTime.Seconds()},
+		{"upstream_time", entry.UpstreamTime.Seconds()},
+		{"referer", entry.Referer},
+		{"user_agent", entry.UserAgent},
+	}
+	if entry.CompressionRatio > 0 {
+		pairs = append(pairs, pair{"compression_ratio", entry.CompressionRatio})
+	}
+	if entry.RequestID != "" {
+		pairs = append(pairs, pair{"request_id", entry.RequestID})
+	}
+	if entry.Error != "" {
+		pairs = append(pairs, pair{"error", singleLine(entry.Error)})
+	}
+	for _, field := range entry.Extra {
+		pairs = append(pairs, pair{field.Name, field.Value})
+	}
+
+	parts := make([]string, len(pairs))
+	for i, p := range pairs {
+		parts[i] = p.key + "=" + logfmtValue(p.value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func logfmtValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" {
+		return "-"
+	}
+	if strings.ContainsAny(s, " \"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// newAccessLogEntry builds the AccessLogEntry for a request/response pair,
+// extracting the fields every Formatter has in common from the raw request.
+func newAccessLogEntry(
+	r *http.Request,
+	remoteIP string,
+	dateTime time.Time,
+	stats responseStats,
+	requestTime, upstreamTime time.Duration,
+	compressionRatio float64) AccessLogEntry {
+	username, _, ok := r.BasicAuth()
+	if !ok {
+		username = ""
+	}
+	referer := ""
+	if len(r.Header["Referer"]) > 0 {
+		referer = r.Header["Referer"][0]
+	}
+	userAgent := r.Header.Get("User-Agent")
+
+	return AccessLogEntry{
+		RemoteAddr:       remoteIP,
+		Username:         username,
+		DateTime:         dateTime,
+		Method:           r.Method,
+		Path:             r.URL.String(),
+		Proto:            r.Proto,
+		StatusCode:       stats.statusCode,
+		BodyBytes:        stats.bodyBytes,
+		RequestTime:      requestTime,
+		UpstreamTime:     upstreamTime,
+		Referer:          referer,
+		UserAgent:        userAgent,
+		CompressionRatio: compressionRatio,
+		RequestID:        RequestIDFromContext(r.Context()),
+	}
+}
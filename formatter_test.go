@@ -0,0 +1,109 @@
+package httpaccesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry() AccessLogEntry {
+	request, _ := http.NewRequest("GET", "/somepage", nil)
+	return AccessLogEntry{
+		RemoteAddr:   "10.1.2.254",
+		Username:     "frank",
+		DateTime:     time.Date(2016, time.June, 13, 15, 19, 37, 0, time.UTC),
+		Method:       request.Method,
+		Path:         "/somepage",
+		Proto:        "HTTP/1.1",
+		StatusCode:   200,
+		BodyBytes:    950,
+		RequestTime:  50 * time.Millisecond,
+		UpstreamTime: 40 * time.Millisecond,
+		Referer:      "https://github.com/",
+		UserAgent:    "Mozilla/5.0",
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	entry := testEntry()
+	entry.RequestID = "abc123"
+	entry.Extra = []Field{{Name: "tls_version", Value: "TLS1.3"}}
+
+	line := JSONFormatter{}.Format(entry)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		t.Fatalf("JSONFormatter produced invalid JSON: %v\n%s", err, line)
+	}
+	if decoded["status"].(float64) != 200 {
+		t.Errorf("expected status 200, got %v", decoded["status"])
+	}
+	if decoded["remote_ip"] != "10.1.2.254" {
+		t.Errorf("expected remote_ip 10.1.2.254, got %v", decoded["remote_ip"])
+	}
+	if decoded["request_id"] != "abc123" {
+		t.Errorf("expected request_id abc123, got %v", decoded["request_id"])
+	}
+	if decoded["tls_version"] != "TLS1.3" {
+		t.Errorf("expected extra field tls_version TLS1.3, got %v", decoded["tls_version"])
+	}
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	entry := testEntry()
+	entry.Extra = []Field{{Name: "trace_id", Value: "has space"}}
+
+	line := LogfmtFormatter{}.Format(entry)
+
+	if !strings.Contains(line, "status=200") {
+		t.Errorf("expected status=200 in %q", line)
+	}
+	if !strings.Contains(line, `remote_ip=10.1.2.254`) {
+		t.Errorf("expected remote_ip=10.1.2.254 in %q", line)
+	}
+	if !strings.Contains(line, `trace_id="has space"`) {
+		t.Errorf("expected quoted trace_id in %q", line)
+	}
+}
+
+func TestAccessLoggerWithFormatter(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := New(target).WithFormatter(JSONFormatter{})
+	request, _ := http.NewRequest("GET", "/somepage", nil)
+	request.RemoteAddr = "10.1.2.254:4567"
+
+	accessLogger.Handle(usageHandler)(blackHole{}, request)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(target.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected a JSON access log line, got %q: %v", target.String(), err)
+	}
+	if decoded["method"] != "GET" {
+		t.Errorf("expected method GET, got %v", decoded["method"])
+	}
+}
+
+func TestAccessLoggerWithFieldExtractor(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := New(target).
+		WithFormatter(JSONFormatter{}).
+		WithFieldExtractor(func(r *http.Request, w http.ResponseWriter) Field {
+			return Field{Name: "host", Value: r.Host}
+		})
+	request, _ := http.NewRequest("GET", "/somepage", nil)
+	request.RemoteAddr = "10.1.2.254:4567"
+	request.Host = "example.com"
+
+	accessLogger.Handle(usageHandler)(blackHole{}, request)
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(target.Bytes(), &decoded); err != nil {
+		t.Fatalf("expected a JSON access log line, got %q: %v", target.String(), err)
+	}
+	if decoded["host"] != "example.com" {
+		t.Errorf("expected extracted field host example.com, got %v", decoded["host"])
+	}
+}
@@ -1,33 +1,19 @@
 package httpaccesslog
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"log"
+	"net"
 	"net/http"
-	"strconv"
-	"strings"
+	"regexp"
 	"time"
 )
 
 type responseStats struct {
 	bodyBytes  int
 	statusCode int
-}
-
-type logResponseWriter struct {
-	http.ResponseWriter
-	stats *responseStats
-}
-
-func (this logResponseWriter) Write(responseBody []byte) (int, error) {
-	this.stats.bodyBytes = len(responseBody)
-	return this.ResponseWriter.Write(responseBody)
-}
-
-func (this logResponseWriter) WriteHeader(statusCode int) {
-	this.stats.statusCode = statusCode
-	this.ResponseWriter.WriteHeader(statusCode)
+	wrote      bool
 }
 
 type clock interface {
@@ -37,11 +23,16 @@ type clock interface {
 type AccessLogger struct {
 	*log.Logger
 	clock
+	formatter        Formatter
+	extractors       []FieldExtractor
+	proxyHeaders     *ProxyHeaders
+	requestIDPattern *regexp.Regexp
+	samplingPolicy   SamplingPolicy
 }
 
 func New(output io.Writer) AccessLogger {
 	logger := log.New(output, "", 0)
-	return AccessLogger{logger, nil}
+	return AccessLogger{logger, nil, nil, nil, nil, nil, nil}
 }
 
 func (this AccessLogger) now() time.Time {
@@ -52,14 +43,65 @@ func (this AccessLogger) now() time.Time {
 	return this.clock.now()
 }
 
+// WithFormatter returns a copy of this AccessLogger that renders entries
+// using formatter instead of the default ApacheCombinedFormatter.
+func (this AccessLogger) WithFormatter(formatter Formatter) AccessLogger {
+	this.formatter = formatter
+	return this
+}
+
+// WithFieldExtractor returns a copy of this AccessLogger that also runs
+// extractor on every request, attaching its Field to the logged entry.
+// Extractors run in registration order.
+func (this AccessLogger) WithFieldExtractor(extractor FieldExtractor) AccessLogger {
+	this.extractors = append(append([]FieldExtractor{}, this.extractors...), extractor)
+	return this
+}
+
+func (this AccessLogger) format(entry AccessLogEntry) string {
+	if this.formatter == nil {
+		return ApacheCombinedFormatter{}.Format(entry)
+	}
+	return this.formatter.Format(entry)
+}
+
+// prepare resolves the per-request state Handle and HandleReturn share
+// (client IP, upstream timing slot, request ID), stores it on r's context,
+// and - for the request ID - echoes it back via w's headers. It returns the
+// request carrying that context, along with the resolved client IP and the
+// upstream timing slot Transport may fill in.
+func (this AccessLogger) prepare(w http.ResponseWriter, r *http.Request) (*http.Request, string, *upstreamTiming) {
+	clientIP := this.clientIP(r)
+	timing := &upstreamTiming{}
+	ctx := context.WithValue(r.Context(), clientIPContextKey, clientIP)
+	ctx = context.WithValue(ctx, upstreamTimingContextKey, timing)
+
+	if this.requestIDPattern != nil {
+		requestID := resolveRequestID(r, this.requestIDPattern)
+		ctx = context.WithValue(ctx, requestIDContextKey, requestID)
+		w.Header().Set(RequestIDHeader, requestID)
+	}
+
+	return r.WithContext(ctx), clientIP, timing
+}
+
 func (this AccessLogger) Handle(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := this.now()
-		stats := responseStats{0, 200}
-		logWriter := logResponseWriter{w, &stats}
+		r, clientIP, timing := this.prepare(w, r)
+		stats := responseStats{0, 200, false}
+		logWriter := wrapResponseWriter(w, &stats)
 		handler(logWriter, r)
 		requestDuration := this.now().Sub(startTime)
-		accessLog := formatAccessLog(r, startTime, stats, requestDuration, requestDuration, 0)
+		if this.samplingPolicy != nil && !this.samplingPolicy.ShouldLog(r, stats, requestDuration) {
+			return
+		}
+		upstreamTime, compressionRatio := resolveUpstreamMetrics(timing, requestDuration, stats.bodyBytes)
+		entry := newAccessLogEntry(r, clientIP, startTime, stats, requestDuration, upstreamTime, compressionRatio)
+		for _, extractor := range this.extractors {
+			entry.Extra = append(entry.Extra, extractor(r, logWriter))
+		}
+		accessLog := this.format(entry)
 		if this.Logger == nil {
 			log.Println(accessLog)
 		} else {
@@ -68,46 +110,19 @@ func (this AccessLogger) Handle(handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// formatAccessLog renders a request/response pair using the default Apache
+// combined format. Kept as a standalone helper (used directly by tests)
+// separate from AccessLogger.format, which also honors a custom Formatter.
 func formatAccessLog(
 	r *http.Request,
 	dateTime time.Time,
 	stats responseStats,
 	requestTime, upstreamTime time.Duration,
 	compressionRatio float64) string {
-	username, _, ok := r.BasicAuth()
-	if !ok || username == "" {
-		username = "-"
-	}
-	referer := "-"
-	userAgent := "-"
-	if len(r.Header["Referer"]) > 0 {
-		referer = r.Header["Referer"][0]
-	}
-	if len(r.Header["UserAgent"]) > 0 {
-		userAgent = r.Header["UserAgent"][0]
-	}
-
-	remoteAddr := strings.Split(r.RemoteAddr, ":")
-	compressionRatioStr := "-"
-	if compressionRatio > 0 {
-		compressionRatioStr = strconv.FormatFloat(compressionRatio, 'f', 2, 64)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
 	}
-	requestSeconds := strconv.FormatFloat(float64(requestTime)/float64(time.Second), 'f', 3, 64)
-	upstreamSeconds := strconv.FormatFloat(float64(upstreamTime)/float64(time.Second), 'f', 3, 64)
-	return fmt.Sprintf(
-		"%s - %s [%s] \"%s %s %s\" %d %d %s/%s \"%s\" \"%s\" %s -",
-		remoteAddr[0],
-		username,
-		dateTime.Format("02/Jan/2006:15:04:05 -0700"),
-		r.Method,
-		r.URL,
-		r.Proto,
-		stats.statusCode,
-		stats.bodyBytes,
-		requestSeconds,
-		upstreamSeconds,
-		referer,
-		userAgent,
-		compressionRatioStr,
-	)
+	entry := newAccessLogEntry(r, host, dateTime, stats, requestTime, upstreamTime, compressionRatio)
+	return ApacheCombinedFormatter{}.Format(entry)
 }
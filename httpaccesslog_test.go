@@ -69,7 +69,7 @@ func TestServeMux(t *testing.T) {
 	target := &bytes.Buffer{}
 	log.SetOutput(target)
 	log.SetFlags(0)
-	accessLogger := AccessLogger{nil, &clockMock{}}
+	accessLogger := AccessLogger{nil, &clockMock{}, nil, nil, nil, nil, nil}
 	http.HandleFunc("/", accessLogger.Handle(notFoundHandler))
 	go http.ListenAndServe(":5000", nil)
 	tests := []struct {
@@ -80,28 +80,28 @@ func TestServeMux(t *testing.T) {
 		{
 			"/NotFound",
 			nil,
-			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /NotFound HTTP/1.1\" 404 0 0.000/0.000 \"-\" \"-\" - -\n",
+			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /NotFound HTTP/1.1\" 404 0 0.000/0.000 \"-\" \"Go-http-client/1.1\" - -\n",
 		},
 		{
 			"/usage",
 			usageHandler,
-			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /usage HTTP/1.1\" 200 78 0.000/0.000 \"-\" \"-\" - -\n",
+			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /usage HTTP/1.1\" 200 78 0.000/0.000 \"-\" \"Go-http-client/1.1\" - -\n",
 		},
 		{
 			"/usage/subpath",
 			nil,
 			// the higher level handler ("/", notFoundHandler) has precedence over ("/usage", usageHandler)
-			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /usage/subpath HTTP/1.1\" 404 0 0.000/0.000 \"-\" \"-\" - -\n",
+			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /usage/subpath HTTP/1.1\" 404 0 0.000/0.000 \"-\" \"Go-http-client/1.1\" - -\n",
 		},
 		{
 			"/denied",
 			deniedHandler,
-			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /denied HTTP/1.1\" 401 0 0.000/0.000 \"-\" \"-\" - -\n",
+			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /denied HTTP/1.1\" 401 0 0.000/0.000 \"-\" \"Go-http-client/1.1\" - -\n",
 		},
 		{
 			"/delayed",
 			delayedHandler,
-			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /delayed HTTP/1.1\" 200 0 0.050/0.050 \"-\" \"-\" - -\n",
+			"127.0.0.1 - user [10/Nov/2009:23:00:00 +0000] \"GET /delayed HTTP/1.1\" 200 0 0.050/0.050 \"-\" \"Go-http-client/1.1\" - -\n",
 		},
 	}
 	for _, tt := range tests {
@@ -120,7 +120,7 @@ func TestServeMux(t *testing.T) {
 
 func TestHandle(t *testing.T) {
 	target := &bytes.Buffer{}
-	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}
 	tests := []struct {
 		remoteAddr string
 		username   string
@@ -180,7 +180,7 @@ func TestHandle(t *testing.T) {
 			request.Header["Referer"] = []string{tt.referer}
 		}
 		if tt.userAgent != "" {
-			request.Header["UserAgent"] = []string{tt.userAgent}
+			request.Header.Set("User-Agent", tt.userAgent)
 		}
 		target.Reset()
 		accessLogger.Handle(tt.handler)(blackHole{}, request)
@@ -281,9 +281,9 @@ func TestFormatAccessLog(t *testing.T) {
 			request.Header["Referer"] = []string{tt.referer}
 		}
 		if tt.userAgent != "" {
-			request.Header["UserAgent"] = []string{tt.userAgent}
+			request.Header.Set("User-Agent", tt.userAgent)
 		}
-		actual := formatAccessLog(request, tt.dateTime, responseStats{tt.responseBodyBytes, tt.status}, tt.requestTime, tt.upstreamTime, tt.compressionRatio)
+		actual := formatAccessLog(request, tt.dateTime, responseStats{tt.responseBodyBytes, tt.status, false}, tt.requestTime, tt.upstreamTime, tt.compressionRatio)
 		if actual != tt.expected {
 			t.Errorf("\nactual\n%s\nexpected\n%s", actual, tt.expected)
 		}
@@ -0,0 +1,78 @@
+package httpaccesslog
+
+import "sort"
+
+// gkSketch is a Greenwald-Khanna epsilon-approximate quantile summary: a
+// bounded list of (value, g, delta) tuples - g is the number of values
+// represented since the previous tuple, delta bounds the uncertainty in
+// that tuple's rank - that answers quantile queries within epsilon*n of the
+// true rank using O(1/epsilon * log(epsilon*n)) space, periodically merging
+// tuples whose combined error still fits the epsilon budget.
+type gkSketch struct {
+	epsilon float64
+	n       int
+	tuples  []gkTuple
+}
+
+type gkTuple struct {
+	value float64
+	g     int
+	delta int
+}
+
+func newGKSketch(epsilon float64) *gkSketch {
+	return &gkSketch{epsilon: epsilon}
+}
+
+func (this *gkSketch) insert(value float64) {
+	i := sort.Search(len(this.tuples), func(i int) bool { return this.tuples[i].value >= value })
+
+	delta := 0
+	if i > 0 && i < len(this.tuples) {
+		delta = int(2*this.epsilon*float64(this.n)) - 1
+		if delta < 0 {
+			delta = 0
+		}
+	}
+	this.tuples = append(this.tuples, gkTuple{})
+	copy(this.tuples[i+1:], this.tuples[i:])
+	this.tuples[i] = gkTuple{value: value, g: 1, delta: delta}
+	this.n++
+
+	compressEvery := int(1/(2*this.epsilon)) + 1
+	if this.n%compressEvery == 0 {
+		this.compress()
+	}
+}
+
+func (this *gkSketch) compress() {
+	threshold := int(2 * this.epsilon * float64(this.n))
+	for i := len(this.tuples) - 2; i >= 1; i-- {
+		if this.tuples[i].g+this.tuples[i+1].g+this.tuples[i+1].delta <= threshold {
+			this.tuples[i+1].g += this.tuples[i].g
+			this.tuples = append(this.tuples[:i], this.tuples[i+1:]...)
+		}
+	}
+}
+
+// quantile returns an epsilon-approximate value for the q-th quantile
+// (0 <= q <= 1) of every value inserted so far.
+func (this *gkSketch) quantile(q float64) float64 {
+	if len(this.tuples) == 0 {
+		return 0
+	}
+	rank := int(q * float64(this.n))
+	threshold := int(this.epsilon * float64(this.n))
+
+	cumulative := 0
+	for i, tuple := range this.tuples {
+		cumulative += tuple.g
+		if cumulative+tuple.delta > rank+threshold {
+			if i == 0 {
+				return tuple.value
+			}
+			return this.tuples[i-1].value
+		}
+	}
+	return this.tuples[len(this.tuples)-1].value
+}
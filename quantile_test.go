@@ -0,0 +1,45 @@
+package httpaccesslog
+
+import "testing"
+
+func TestGKSketchQuantilesApproximateSortedInput(t *testing.T) {
+	sketch := newGKSketch(0.01)
+	for i := 1; i <= 1000; i++ {
+		sketch.insert(float64(i))
+	}
+
+	cases := []struct {
+		q        float64
+		expected float64
+	}{
+		{0.50, 500},
+		{0.95, 950},
+		{0.99, 990},
+	}
+
+	for _, tt := range cases {
+		got := sketch.quantile(tt.q)
+		diff := got - tt.expected
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > 0.03*1000 {
+			t.Errorf("quantile(%v): expected approximately %v, got %v", tt.q, tt.expected, got)
+		}
+	}
+}
+
+func TestGKSketchEmptyQuantileIsZero(t *testing.T) {
+	sketch := newGKSketch(0.01)
+	if q := sketch.quantile(0.5); q != 0 {
+		t.Errorf("expected quantile of an empty sketch to be 0, got %v", q)
+	}
+}
+
+func TestGKSketchSingleValue(t *testing.T) {
+	sketch := newGKSketch(0.01)
+	sketch.insert(42)
+	if q := sketch.quantile(0.5); q != 42 {
+		t.Errorf("expected the only inserted value back, got %v", q)
+	}
+}
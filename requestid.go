@@ -0,0 +1,74 @@
+package httpaccesslog
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+type requestIDKey int
+
+const requestIDContextKey requestIDKey = iota
+
+// RequestIDHeader is the header AccessLogger reads an inbound request ID
+// from, and echoes the resolved one back on, when WithRequestID is enabled.
+const RequestIDHeader = "X-Request-Id"
+
+// defaultRequestIDPattern accepts UUIDs (what this package generates) along
+// with other common request-ID shapes (ULIDs, hex trace IDs) so an ID set by
+// an upstream proxy is reused instead of being replaced.
+var defaultRequestIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// WithRequestID returns a copy of this AccessLogger that assigns every
+// request a unique ID: the incoming X-Request-Id header when present and
+// matching pattern, otherwise a freshly generated UUIDv7. The ID is stashed
+// on the request context (retrievable with RequestIDFromContext), echoed
+// back via X-Request-Id, and logged as the request_id field by JSONFormatter
+// and LogfmtFormatter; the default ApacheCombinedFormatter does not include
+// it in its line. A nil pattern uses defaultRequestIDPattern.
+func (this AccessLogger) WithRequestID(pattern *regexp.Regexp) AccessLogger {
+	if pattern == nil {
+		pattern = defaultRequestIDPattern
+	}
+	this.requestIDPattern = pattern
+	return this
+}
+
+// RequestIDFromContext returns the request ID AccessLogger assigned to the
+// request carrying ctx, or "" if WithRequestID wasn't enabled.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// resolveRequestID reuses r's incoming X-Request-Id header when it matches
+// pattern, otherwise generates a new UUIDv7.
+func resolveRequestID(r *http.Request, pattern *regexp.Regexp) string {
+	if incoming := r.Header.Get(RequestIDHeader); incoming != "" && pattern.MatchString(incoming) {
+		return incoming
+	}
+	return newRequestID()
+}
+
+// newRequestID generates a UUIDv7: a 48-bit big-endian millisecond Unix
+// timestamp followed by 74 random bits, so IDs generated in a later
+// millisecond sort after ones generated earlier; IDs from the same
+// millisecond are in random order.
+func newRequestID() string {
+	var uuid [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	uuid[0] = byte(ms >> 40)
+	uuid[1] = byte(ms >> 32)
+	uuid[2] = byte(ms >> 24)
+	uuid[3] = byte(ms >> 16)
+	uuid[4] = byte(ms >> 8)
+	uuid[5] = byte(ms)
+	rand.Read(uuid[6:])
+	uuid[6] = (uuid[6] & 0x0f) | 0x70 // version 7
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
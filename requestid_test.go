@@ -0,0 +1,73 @@
+package httpaccesslog
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithRequestIDGeneratesWhenAbsent(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := New(target).WithFormatter(JSONFormatter{}).WithRequestID(nil)
+	var seen string
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	accessLogger.Handle(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	})(recorder, request)
+
+	if seen == "" {
+		t.Fatal("expected a generated request ID to reach the handler")
+	}
+	if recorder.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("expected %s response header to echo %q, got %q", RequestIDHeader, seen, recorder.Header().Get(RequestIDHeader))
+	}
+	if !bytes.Contains(target.Bytes(), []byte(`"request_id":"`+seen+`"`)) {
+		t.Errorf("expected request_id in access log, got %q", target.String())
+	}
+}
+
+func TestWithRequestIDReusesValidIncoming(t *testing.T) {
+	accessLogger := New(io.Discard).WithRequestID(nil)
+	var seen string
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "incoming-request-id-123")
+	accessLogger.Handle(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	})(recorder, request)
+
+	if seen != "incoming-request-id-123" {
+		t.Errorf("expected the valid incoming request ID to be reused, got %q", seen)
+	}
+}
+
+func TestWithRequestIDRejectsInvalidIncoming(t *testing.T) {
+	accessLogger := New(io.Discard).WithRequestID(nil)
+	var seen string
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIDHeader, "short")
+	accessLogger.Handle(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	})(recorder, request)
+
+	if seen == "short" {
+		t.Error("expected an invalid incoming request ID to be replaced with a generated one")
+	}
+	if seen == "" {
+		t.Error("expected a generated request ID to replace the invalid incoming one")
+	}
+}
+
+func TestRequestIDFromContextWithoutAccessLogger(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	if id := RequestIDFromContext(request.Context()); id != "" {
+		t.Errorf("expected empty request ID, got %q", id)
+	}
+}
@@ -0,0 +1,123 @@
+package httpaccesslog
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// ReturnHandler is an http.Handler variant that returns an error instead of
+// writing one itself, inspired by tsweb's StdHandler. AccessLogger.HandleReturn
+// centralizes turning that error into a response and an access log entry, so
+// individual handlers don't each re-implement WriteHeader+log+respond.
+type ReturnHandler interface {
+	ServeHTTPReturn(w http.ResponseWriter, r *http.Request) error
+}
+
+// ReturnHandlerFunc adapts a plain function to a ReturnHandler.
+type ReturnHandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+func (this ReturnHandlerFunc) ServeHTTPReturn(w http.ResponseWriter, r *http.Request) error {
+	return this(w, r)
+}
+
+// VisibleError marks an error message as safe to send to the client
+// verbatim. Errors that don't satisfy this are treated as internal: their
+// detail goes to the access log, and the client gets a generic message.
+type VisibleError struct {
+	msg string
+}
+
+func (this VisibleError) Error() string {
+	return this.msg
+}
+
+// Visible wraps msg as a VisibleError.
+func Visible(msg string) error {
+	return VisibleError{msg}
+}
+
+// Visiblef is like Visible but formats its message the way fmt.Errorf does.
+func Visiblef(format string, a ...interface{}) error {
+	return VisibleError{fmt.Sprintf(format, a...)}
+}
+
+func visibleMessage(err error) (string, bool) {
+	var visible VisibleError
+	if errors.As(err, &visible) {
+		return visible.msg, true
+	}
+	return "", false
+}
+
+// HandleReturn wraps a ReturnHandler the way Handle wraps an http.HandlerFunc:
+// it captures response stats for the access log, but it also recovers
+// panics (converting them into a 500 and logging the stack), picks apart
+// VisibleError from internal errors when the handler returns one without
+// having written a response itself, and records the error plus final status
+// code as additional access log fields. http.ErrAbortHandler, whether
+// returned or panicked with, is treated as a silent abort: no response is
+// written and the panic is left to propagate so the server can close the
+// connection without logging anything.
+func (this AccessLogger) HandleReturn(handler ReturnHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := this.now()
+		r, clientIP, timing := this.prepare(w, r)
+		stats := responseStats{0, 200, false}
+		logWriter := wrapResponseWriter(w, &stats)
+
+		handlerErr := this.serveReturn(handler, logWriter, &stats, r)
+		if handlerErr == http.ErrAbortHandler {
+			panic(http.ErrAbortHandler)
+		}
+
+		requestDuration := this.now().Sub(startTime)
+		if this.samplingPolicy != nil && !this.samplingPolicy.ShouldLog(r, stats, requestDuration) {
+			return
+		}
+		upstreamTime, compressionRatio := resolveUpstreamMetrics(timing, requestDuration, stats.bodyBytes)
+		entry := newAccessLogEntry(r, clientIP, startTime, stats, requestDuration, upstreamTime, compressionRatio)
+		if handlerErr != nil {
+			entry.Error = handlerErr.Error()
+		}
+		for _, extractor := range this.extractors {
+			entry.Extra = append(entry.Extra, extractor(r, logWriter))
+		}
+		accessLog := this.format(entry)
+		if this.Logger == nil {
+			log.Println(accessLog)
+		} else {
+			this.Logger.Println(accessLog)
+		}
+	}
+}
+
+// serveReturn invokes handler, recovering any panic and turning whatever
+// error comes out of it - returned or recovered - into a response, unless
+// the handler already wrote one itself.
+func (this AccessLogger) serveReturn(handler ReturnHandler, w http.ResponseWriter, stats *responseStats, r *http.Request) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if recovered == http.ErrAbortHandler {
+				err = http.ErrAbortHandler
+				return
+			}
+			err = fmt.Errorf("panic: %v\n%s", recovered, debug.Stack())
+			if !stats.wrote {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+		}
+	}()
+
+	err = handler.ServeHTTPReturn(w, r)
+	if err != nil && err != http.ErrAbortHandler && !stats.wrote {
+		if msg, ok := visibleMessage(err); ok {
+			http.Error(w, msg, http.StatusBadRequest)
+		} else {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}
+	return err
+}
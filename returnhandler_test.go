@@ -0,0 +1,162 @@
+package httpaccesslog
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleReturnNilError(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}.WithFormatter(JSONFormatter{})
+
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/ok", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", recorder.Code)
+	}
+	if bytes.Contains(target.Bytes(), []byte(`"error"`)) {
+		t.Errorf("expected no error field in log, got %q", target.String())
+	}
+}
+
+func TestHandleReturnInternalError(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}.WithFormatter(JSONFormatter{})
+
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("database exploded")
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/broken", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", recorder.Code)
+	}
+	if bytes.Contains(recorder.Body.Bytes(), []byte("database exploded")) {
+		t.Error("expected internal error detail not to reach the client")
+	}
+	if !bytes.Contains(target.Bytes(), []byte("database exploded")) {
+		t.Errorf("expected internal error detail in access log, got %q", target.String())
+	}
+}
+
+func TestHandleReturnVisibleError(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}.WithFormatter(JSONFormatter{})
+
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return Visible("missing parameter foo")
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/bad-request", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", recorder.Code)
+	}
+	if !bytes.Contains(recorder.Body.Bytes(), []byte("missing parameter foo")) {
+		t.Errorf("expected visible error to reach the client, got %q", recorder.Body.String())
+	}
+}
+
+func TestHandleReturnPanicRecovers(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}.WithFormatter(JSONFormatter{})
+
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		panic("boom")
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/panics", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", recorder.Code)
+	}
+	if !bytes.Contains(target.Bytes(), []byte("panic: boom")) {
+		t.Errorf("expected panic detail in access log, got %q", target.String())
+	}
+}
+
+func TestHandleReturnDoesNotDoubleWriteAfterStreamedBody(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}.WithFormatter(JSONFormatter{})
+
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("partial body"))
+		return errors.New("late failure")
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/streams-then-fails", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the implicit 200 from the first Write to stand, got %d", recorder.Code)
+	}
+	if recorder.Body.String() != "partial body" {
+		t.Errorf("expected no Internal Server Error appended to an already-started body, got %q", recorder.Body.String())
+	}
+	if !bytes.Contains(target.Bytes(), []byte("late failure")) {
+		t.Errorf("expected the late failure to still reach the access log, got %q", target.String())
+	}
+}
+
+func TestHandleReturnPanicAfterStreamedBodyDoesNotDoubleWrite(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := AccessLogger{log.New(target, "", 0), &clockMock{}, nil, nil, nil, nil, nil}.WithFormatter(JSONFormatter{})
+
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("partial body"))
+		panic("boom")
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/streams-then-panics", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the implicit 200 from the first Write to stand, got %d", recorder.Code)
+	}
+	if recorder.Body.String() != "partial body" {
+		t.Errorf("expected no Internal Server Error appended to an already-started body, got %q", recorder.Body.String())
+	}
+	if !bytes.Contains(target.Bytes(), []byte("panic: boom")) {
+		t.Errorf("expected panic detail in access log, got %q", target.String())
+	}
+}
+
+func TestHandleReturnAbortHandlerIsSilent(t *testing.T) {
+	defer func() {
+		recovered := recover()
+		if recovered != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to propagate, got %v", recovered)
+		}
+	}()
+
+	accessLogger := AccessLogger{nil, &clockMock{}, nil, nil, nil, nil, nil}
+	handler := ReturnHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return http.ErrAbortHandler
+	})
+
+	recorder := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/abort", nil)
+	accessLogger.HandleReturn(handler)(recorder, request)
+
+	t.Fatal("expected HandleReturn to panic with http.ErrAbortHandler")
+}
@@ -0,0 +1,200 @@
+package httpaccesslog
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StatusCode returns the status code AccessLogger captured for the response.
+// responseStats is unexported, so SamplingPolicy implementations (which
+// take it as a parameter) can only be written inside this package.
+func (this responseStats) StatusCode() int { return this.statusCode }
+
+// BodyBytes returns the response body size AccessLogger captured.
+func (this responseStats) BodyBytes() int { return this.bodyBytes }
+
+// SamplingPolicy decides, once a request has finished, whether it should be
+// written to the access log. Install one with AccessLogger.WithSamplingPolicy
+// to down-sample high-QPS endpoints without losing 4xx/5xx visibility.
+type SamplingPolicy interface {
+	ShouldLog(r *http.Request, stats responseStats, dur time.Duration) bool
+}
+
+// SamplingPolicyFunc adapts a function to a SamplingPolicy.
+type SamplingPolicyFunc func(r *http.Request, stats responseStats, dur time.Duration) bool
+
+func (this SamplingPolicyFunc) ShouldLog(r *http.Request, stats responseStats, dur time.Duration) bool {
+	return this(r, stats, dur)
+}
+
+// WithSamplingPolicy returns a copy of this AccessLogger that consults
+// policy after every request and only logs the ones it approves.
+func (this AccessLogger) WithSamplingPolicy(policy SamplingPolicy) AccessLogger {
+	this.samplingPolicy = policy
+	return this
+}
+
+// FixedRateSampling approves roughly 1 in every N requests it sees,
+// regardless of status code. Combine with AlwaysLogErrors to keep 4xx/5xx
+// unconditionally logged.
+type FixedRateSampling struct {
+	N int
+
+	counter uint64
+}
+
+func (this *FixedRateSampling) ShouldLog(r *http.Request, stats responseStats, dur time.Duration) bool {
+	if this.N <= 1 {
+		return true
+	}
+	n := atomic.AddUint64(&this.counter, 1)
+	return n%uint64(this.N) == 1
+}
+
+// AlwaysLogErrors always approves 4xx/5xx responses and defers to Success
+// (if set) for everything else - the common "always-log-errors,
+// sample-success-at-rate-R" policy.
+type AlwaysLogErrors struct {
+	Success SamplingPolicy
+}
+
+func (this AlwaysLogErrors) ShouldLog(r *http.Request, stats responseStats, dur time.Duration) bool {
+	if stats.StatusCode() >= http.StatusBadRequest {
+		return true
+	}
+	if this.Success == nil {
+		return true
+	}
+	return this.Success.ShouldLog(r, stats, dur)
+}
+
+// TokenBucketPerRoute rate-limits logging per request path: each distinct
+// r.URL.Path gets its own bucket of up to Burst tokens, refilled at
+// RatePerSecond tokens/sec, consumed one per approved request.
+type TokenBucketPerRoute struct {
+	RatePerSecond float64
+	Burst         float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastFill time.Time
+}
+
+func (this *TokenBucketPerRoute) ShouldLog(r *http.Request, stats responseStats, dur time.Duration) bool {
+	now := time.Now()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.buckets == nil {
+		this.buckets = make(map[string]*tokenBucket)
+	}
+	bucket, ok := this.buckets[r.URL.Path]
+	if !ok {
+		bucket = &tokenBucket{tokens: this.Burst, lastFill: now}
+		this.buckets[r.URL.Path] = bucket
+	} else {
+		elapsed := now.Sub(bucket.lastFill).Seconds()
+		bucket.tokens += elapsed * this.RatePerSecond
+		if bucket.tokens > this.Burst {
+			bucket.tokens = this.Burst
+		}
+		bucket.lastFill = now
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// SamplingAggregator wraps an inner SamplingPolicy: every request Inner
+// sampled out is folded into a per route+status summary (count, bytes, and
+// a latency quantile sketch) instead of being dropped silently. Call Flush
+// on a timer to log and clear those summaries, so operators keep
+// tail-latency visibility for endpoints being down-sampled. A nil Inner
+// approves every request, the same as a nil AlwaysLogErrors.Success.
+type SamplingAggregator struct {
+	Inner SamplingPolicy
+
+	mu      sync.Mutex
+	buckets map[string]*sampledBucket
+}
+
+type sampledBucket struct {
+	mu      sync.Mutex
+	count   int
+	bytes   int
+	latency *gkSketch
+}
+
+func (this *SamplingAggregator) ShouldLog(r *http.Request, stats responseStats, dur time.Duration) bool {
+	if this.Inner == nil || this.Inner.ShouldLog(r, stats, dur) {
+		return true
+	}
+	this.record(r, stats, dur)
+	return false
+}
+
+func (this *SamplingAggregator) record(r *http.Request, stats responseStats, dur time.Duration) {
+	key := fmt.Sprintf("%s %d", r.URL.Path, stats.StatusCode())
+
+	this.mu.Lock()
+	if this.buckets == nil {
+		this.buckets = make(map[string]*sampledBucket)
+	}
+	bucket, ok := this.buckets[key]
+	if !ok {
+		bucket = &sampledBucket{latency: newGKSketch(0.01)}
+		this.buckets[key] = bucket
+	}
+	this.mu.Unlock()
+
+	bucket.mu.Lock()
+	bucket.count++
+	bucket.bytes += stats.BodyBytes()
+	bucket.latency.insert(dur.Seconds())
+	bucket.mu.Unlock()
+}
+
+// Flush logs one summary line per route+status bucket that accumulated
+// sampled-out requests since the last Flush, through logger, then clears
+// those buckets.
+func (this *SamplingAggregator) Flush(logger AccessLogger) {
+	this.mu.Lock()
+	buckets := this.buckets
+	this.buckets = nil
+	this.mu.Unlock()
+
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		bucket := buckets[key]
+		bucket.mu.Lock()
+		line := fmt.Sprintf(
+			"sampled_summary bucket=%q count=%d bytes=%d p50=%.3f p95=%.3f p99=%.3f",
+			key, bucket.count, bucket.bytes,
+			bucket.latency.quantile(0.50), bucket.latency.quantile(0.95), bucket.latency.quantile(0.99),
+		)
+		bucket.mu.Unlock()
+
+		if logger.Logger == nil {
+			log.Println(line)
+		} else {
+			logger.Logger.Println(line)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package httpaccesslog
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFixedRateSamplingApproxOneInN(t *testing.T) {
+	policy := &FixedRateSampling{N: 10}
+	request, _ := http.NewRequest("GET", "/", nil)
+	stats := responseStats{0, 200, false}
+
+	approved := 0
+	for i := 0; i < 100; i++ {
+		if policy.ShouldLog(request, stats, 0) {
+			approved++
+		}
+	}
+
+	if approved != 10 {
+		t.Errorf("expected exactly 10 of 100 requests approved at N=10, got %d", approved)
+	}
+}
+
+func TestFixedRateSamplingZeroOrOneLogsEverything(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	stats := responseStats{0, 200, false}
+
+	for _, n := range []int{0, 1} {
+		policy := &FixedRateSampling{N: n}
+		for i := 0; i < 5; i++ {
+			if !policy.ShouldLog(request, stats, 0) {
+				t.Fatalf("expected N=%d to approve every request, rejected on iteration %d", n, i)
+			}
+		}
+	}
+}
+
+func TestAlwaysLogErrorsApprovesErrorStatus(t *testing.T) {
+	policy := AlwaysLogErrors{Success: &FixedRateSampling{N: 1000}}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	if !policy.ShouldLog(request, responseStats{0, 500, false}, 0) {
+		t.Error("expected a 500 response to always be approved")
+	}
+	if !policy.ShouldLog(request, responseStats{0, 404, false}, 0) {
+		t.Error("expected a 404 response to always be approved")
+	}
+}
+
+func TestAlwaysLogErrorsDefersToSuccessForNon4xx5xx(t *testing.T) {
+	policy := AlwaysLogErrors{Success: SamplingPolicyFunc(func(r *http.Request, stats responseStats, dur time.Duration) bool {
+		return false
+	})}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	if policy.ShouldLog(request, responseStats{0, 200, false}, 0) {
+		t.Error("expected a 200 response to defer to Success, which rejected it")
+	}
+}
+
+func TestAlwaysLogErrorsWithoutSuccessApprovesEverything(t *testing.T) {
+	policy := AlwaysLogErrors{}
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	if !policy.ShouldLog(request, responseStats{0, 200, false}, 0) {
+		t.Error("expected a nil Success policy to approve every request")
+	}
+}
+
+func TestTokenBucketPerRouteEnforcesBurstThenRefill(t *testing.T) {
+	policy := &TokenBucketPerRoute{RatePerSecond: 1000, Burst: 2}
+	request, _ := http.NewRequest("GET", "/checkout", nil)
+	stats := responseStats{0, 200, false}
+
+	if !policy.ShouldLog(request, stats, 0) {
+		t.Fatal("expected the first request to consume a burst token")
+	}
+	if !policy.ShouldLog(request, stats, 0) {
+		t.Fatal("expected the second request to consume the last burst token")
+	}
+	if policy.ShouldLog(request, stats, 0) {
+		t.Fatal("expected the third request to be rejected once the burst is exhausted")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if !policy.ShouldLog(request, stats, 0) {
+		t.Error("expected the bucket to have refilled after waiting")
+	}
+}
+
+func TestTokenBucketPerRouteIsolatesRoutes(t *testing.T) {
+	policy := &TokenBucketPerRoute{RatePerSecond: 0, Burst: 1}
+	stats := responseStats{0, 200, false}
+	first, _ := http.NewRequest("GET", "/a", nil)
+	second, _ := http.NewRequest("GET", "/b", nil)
+
+	if !policy.ShouldLog(first, stats, 0) {
+		t.Fatal("expected /a to get its own burst token")
+	}
+	if !policy.ShouldLog(second, stats, 0) {
+		t.Fatal("expected /b to get its own burst token, independent of /a")
+	}
+}
+
+func TestSamplingAggregatorFlushSummarizesSampledOutRequests(t *testing.T) {
+	aggregator := &SamplingAggregator{Inner: SamplingPolicyFunc(func(r *http.Request, stats responseStats, dur time.Duration) bool {
+		return false
+	})}
+	request, _ := http.NewRequest("GET", "/ping", nil)
+
+	for i := 0; i < 5; i++ {
+		if aggregator.ShouldLog(request, responseStats{100, 200, false}, time.Duration(i+1)*time.Millisecond) {
+			t.Fatal("expected Inner's rejection to be honored")
+		}
+	}
+
+	target := &bytes.Buffer{}
+	aggregator.Flush(New(target))
+
+	line := target.String()
+	if !strings.Contains(line, `bucket="/ping 200"`) {
+		t.Errorf("expected a bucket for /ping 200, got %q", line)
+	}
+	if !strings.Contains(line, "count=5") {
+		t.Errorf("expected count=5, got %q", line)
+	}
+	if !strings.Contains(line, "bytes=500") {
+		t.Errorf("expected bytes=500, got %q", line)
+	}
+}
+
+func TestSamplingAggregatorApprovesWhatInnerApproves(t *testing.T) {
+	aggregator := &SamplingAggregator{Inner: SamplingPolicyFunc(func(r *http.Request, stats responseStats, dur time.Duration) bool {
+		return true
+	})}
+	request, _ := http.NewRequest("GET", "/ping", nil)
+
+	if !aggregator.ShouldLog(request, responseStats{0, 200, false}, 0) {
+		t.Error("expected Inner's approval to be honored")
+	}
+}
+
+func TestSamplingAggregatorNilInnerApprovesEverything(t *testing.T) {
+	aggregator := &SamplingAggregator{}
+	request, _ := http.NewRequest("GET", "/ping", nil)
+
+	if !aggregator.ShouldLog(request, responseStats{0, 200, false}, 0) {
+		t.Error("expected a nil Inner to approve every request")
+	}
+}
+
+func TestSamplingAggregatorFlushClearsBuckets(t *testing.T) {
+	aggregator := &SamplingAggregator{Inner: SamplingPolicyFunc(func(r *http.Request, stats responseStats, dur time.Duration) bool {
+		return false
+	})}
+	request, _ := http.NewRequest("GET", "/ping", nil)
+	aggregator.ShouldLog(request, responseStats{0, 200, false}, time.Millisecond)
+
+	aggregator.Flush(New(bytes.NewBuffer(nil)))
+
+	target := &bytes.Buffer{}
+	aggregator.Flush(New(target))
+	if target.Len() != 0 {
+		t.Errorf("expected the second Flush to find no accumulated buckets, got %q", target.String())
+	}
+}
+
+func TestAccessLoggerWithSamplingPolicySkipsRejectedRequests(t *testing.T) {
+	target := &bytes.Buffer{}
+	accessLogger := New(target).WithSamplingPolicy(SamplingPolicyFunc(func(r *http.Request, stats responseStats, dur time.Duration) bool {
+		return false
+	}))
+
+	accessLogger.Handle(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(blackHole{}, mustGet(t, "/"))
+
+	if target.Len() != 0 {
+		t.Errorf("expected a rejected request to produce no access log line, got %q", target.String())
+	}
+}
+
+func mustGet(t *testing.T, path string) *http.Request {
+	request, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	return request
+}
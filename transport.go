@@ -0,0 +1,105 @@
+package httpaccesslog
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type upstreamTimingKey int
+
+const upstreamTimingContextKey upstreamTimingKey = iota
+
+// upstreamTiming is stashed on a request's context by Handle/HandleReturn
+// before invoking the wrapped handler, and filled in by Transport if that
+// handler is (or contains) an httputil.ReverseProxy using it. duration is
+// the time spent waiting on the upstream's response headers; compressedBytes
+// is the response body's size as sent by the upstream - its Content-Length
+// when one was sent, otherwise the bytes counted while the body was read -
+// and is only meaningful once haveCompressedBytes is set (at once for a
+// Content-Length, otherwise when the body is closed).
+type upstreamTiming struct {
+	duration            time.Duration
+	compressedBytes     int64
+	haveCompressedBytes bool
+}
+
+// Transport wraps base (http.DefaultTransport if nil) to record, on the
+// request's context, the time spent waiting for the upstream's response
+// headers and the size of its body as sent (Content-Length, or the bytes
+// read). Install it as an httputil.ReverseProxy's Transport so
+// AccessLogger.Handle can report a real upstreamTime and compressionRatio
+// instead of the placeholder values it falls back to for handlers that
+// don't proxy anywhere. When base has transparently decompressed the body
+// (http.Response.Uncompressed), no body size is recorded and no
+// compressionRatio is reported.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return timingTransport{base}
+}
+
+type timingTransport struct {
+	base http.RoundTripper
+}
+
+func (this timingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := this.base.RoundTrip(r)
+	if err != nil {
+		return response, err
+	}
+
+	timing, ok := r.Context().Value(upstreamTimingContextKey).(*upstreamTiming)
+	if !ok {
+		return response, err
+	}
+	timing.duration = time.Since(start)
+
+	if response.ContentLength >= 0 {
+		timing.compressedBytes = response.ContentLength
+		timing.haveCompressedBytes = true
+	} else if !response.Uncompressed && response.Body != nil {
+		response.Body = &countingReadCloser{ReadCloser: response.Body, timing: timing}
+	}
+	return response, err
+}
+
+// countingReadCloser counts the bytes read through it, recording them on
+// timing once the underlying body is closed - which net/http's client and
+// httputil.ReverseProxy both do only after the body has been fully copied.
+type countingReadCloser struct {
+	io.ReadCloser
+	timing *upstreamTiming
+	count  int64
+}
+
+func (this *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := this.ReadCloser.Read(p)
+	atomic.AddInt64(&this.count, int64(n))
+	return n, err
+}
+
+func (this *countingReadCloser) Close() error {
+	this.timing.compressedBytes = atomic.LoadInt64(&this.count)
+	this.timing.haveCompressedBytes = true
+	return this.ReadCloser.Close()
+}
+
+// resolveUpstreamMetrics turns what Transport recorded on timing into the
+// upstreamTime and compressionRatio to log, falling back to requestDuration
+// and an unknown (zero) ratio for handlers that never touched a Transport.
+func resolveUpstreamMetrics(timing *upstreamTiming, requestDuration time.Duration, bodyBytes int) (time.Duration, float64) {
+	upstreamTime := requestDuration
+	if timing.duration > 0 {
+		upstreamTime = timing.duration
+	}
+
+	compressionRatio := 0.0
+	if timing.haveCompressedBytes && timing.compressedBytes > 0 && bodyBytes > 0 {
+		compressionRatio = float64(bodyBytes) / float64(timing.compressedBytes)
+	}
+	return upstreamTime, compressionRatio
+}
@@ -0,0 +1,73 @@
+package httpaccesslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTransportRecordsUpstreamTiming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	proxy.Transport = Transport(nil)
+
+	target := &bytes.Buffer{}
+	accessLogger := New(target).WithFormatter(JSONFormatter{})
+	server := httptest.NewServer(accessLogger.Handle(proxy.ServeHTTP))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if !bytes.Contains(target.Bytes(), []byte(`"upstream_time":0.02`)) {
+		t.Errorf("expected a non-trivial upstream_time in %q", target.String())
+	}
+}
+
+func TestTransportRecordsCompressionRatio(t *testing.T) {
+	var compressedBody bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressedBody)
+	gzipWriter.Write(bytes.Repeat([]byte("a"), 1000))
+	gzipWriter.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressedBody.Bytes())
+	}))
+	defer upstream.Close()
+
+	upstreamURL, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	proxy.Transport = Transport(&http.Transport{DisableCompression: true})
+
+	target := &bytes.Buffer{}
+	accessLogger := New(target).WithFormatter(JSONFormatter{})
+	server := httptest.NewServer(accessLogger.Handle(proxy.ServeHTTP))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if !bytes.Contains(target.Bytes(), []byte(`"compression_ratio"`)) {
+		t.Errorf("expected a compression_ratio field in %q", target.String())
+	}
+}
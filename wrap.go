@@ -0,0 +1,171 @@
+package httpaccesslog
+
+import "net/http"
+
+// logResponseWriter wraps a http.ResponseWriter to capture the status code
+// and body size of a response as it passes through the access-log layer.
+type logResponseWriter struct {
+	http.ResponseWriter
+	stats *responseStats
+}
+
+func (this logResponseWriter) Write(responseBody []byte) (int, error) {
+	this.stats.wrote = true
+	n, err := this.ResponseWriter.Write(responseBody)
+	this.stats.bodyBytes += n
+	return n, err
+}
+
+func (this logResponseWriter) WriteHeader(statusCode int) {
+	this.stats.wrote = true
+	this.stats.statusCode = statusCode
+	this.ResponseWriter.WriteHeader(statusCode)
+}
+
+// The following types each embed logResponseWriter alongside whichever of
+// http.Hijacker, http.Flusher, http.Pusher and http.CloseNotifier the wrapped
+// ResponseWriter implements. Embedding the interfaces directly lets Go
+// promote their methods, so each combination exposes exactly the optional
+// interfaces the original writer had - nothing more, nothing less. This
+// mirrors the httpsnoop approach: callers that type-assert a ResponseWriter
+// for e.g. http.Hijacker (WebSocket upgrades), http.Flusher (SSE) or
+// http.Pusher (HTTP/2 server push) keep working through this wrapper.
+type hijack struct {
+	logResponseWriter
+	http.Hijacker
+}
+
+type flush struct {
+	logResponseWriter
+	http.Flusher
+}
+
+type push struct {
+	logResponseWriter
+	http.Pusher
+}
+
+type closeNotify struct {
+	logResponseWriter
+	http.CloseNotifier
+}
+
+type hijackFlush struct {
+	logResponseWriter
+	http.Hijacker
+	http.Flusher
+}
+
+type hijackPush struct {
+	logResponseWriter
+	http.Hijacker
+	http.Pusher
+}
+
+type hijackCloseNotify struct {
+	logResponseWriter
+	http.Hijacker
+	http.CloseNotifier
+}
+
+type flushPush struct {
+	logResponseWriter
+	http.Flusher
+	http.Pusher
+}
+
+type flushCloseNotify struct {
+	logResponseWriter
+	http.Flusher
+	http.CloseNotifier
+}
+
+type pushCloseNotify struct {
+	logResponseWriter
+	http.Pusher
+	http.CloseNotifier
+}
+
+type hijackFlushPush struct {
+	logResponseWriter
+	http.Hijacker
+	http.Flusher
+	http.Pusher
+}
+
+type hijackFlushCloseNotify struct {
+	logResponseWriter
+	http.Hijacker
+	http.Flusher
+	http.CloseNotifier
+}
+
+type hijackPushCloseNotify struct {
+	logResponseWriter
+	http.Hijacker
+	http.Pusher
+	http.CloseNotifier
+}
+
+type flushPushCloseNotify struct {
+	logResponseWriter
+	http.Flusher
+	http.Pusher
+	http.CloseNotifier
+}
+
+type hijackFlushPushCloseNotify struct {
+	logResponseWriter
+	http.Hijacker
+	http.Flusher
+	http.Pusher
+	http.CloseNotifier
+}
+
+// wrapResponseWriter returns a logResponseWriter that also exposes whichever
+// of http.Hijacker, http.Flusher, http.Pusher and http.CloseNotifier w
+// implements, so that handlers relying on those optional interfaces (e.g.
+// gorilla/websocket, SSE streaming, HTTP/2 push) keep working when wrapped
+// by AccessLogger.Handle.
+func wrapResponseWriter(w http.ResponseWriter, stats *responseStats) http.ResponseWriter {
+	base := logResponseWriter{w, stats}
+	hj, isHijacker := w.(http.Hijacker)
+	fl, isFlusher := w.(http.Flusher)
+	ps, isPusher := w.(http.Pusher)
+	cn, isCloseNotifier := w.(http.CloseNotifier)
+
+	switch {
+	case isHijacker && isFlusher && isPusher && isCloseNotifier:
+		return hijackFlushPushCloseNotify{base, hj, fl, ps, cn}
+	case isHijacker && isFlusher && isPusher:
+		return hijackFlushPush{base, hj, fl, ps}
+	case isHijacker && isFlusher && isCloseNotifier:
+		return hijackFlushCloseNotify{base, hj, fl, cn}
+	case isHijacker && isPusher && isCloseNotifier:
+		return hijackPushCloseNotify{base, hj, ps, cn}
+	case isFlusher && isPusher && isCloseNotifier:
+		return flushPushCloseNotify{base, fl, ps, cn}
+	case isHijacker && isFlusher:
+		return hijackFlush{base, hj, fl}
+	case isHijacker && isPusher:
+		return hijackPush{base, hj, ps}
+	case isHijacker && isCloseNotifier:
+		return hijackCloseNotify{base, hj, cn}
+	case isFlusher && isPusher:
+		return flushPush{base, fl, ps}
+	case isFlusher && isCloseNotifier:
+		return flushCloseNotify{base, fl, cn}
+	case isPusher && isCloseNotifier:
+		return pushCloseNotify{base, ps, cn}
+	case isHijacker:
+		return hijack{base, hj}
+	case isFlusher:
+		return flush{base, fl}
+	case isPusher:
+		return push{base, ps}
+	case isCloseNotifier:
+		return closeNotify{base, cn}
+	default:
+		return base
+	}
+}
@@ -0,0 +1,84 @@
+package httpaccesslog
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (this *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	this.hijacked = true
+	return nil, nil, nil
+}
+
+func TestWrapResponseWriterPreservesHijacker(t *testing.T) {
+	inner := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	stats := responseStats{0, 200, false}
+	wrapped := wrapResponseWriter(inner, &stats)
+
+	hijacker, ok := wrapped.(http.Hijacker)
+	if !ok {
+		t.Fatal("expected wrapped writer to implement http.Hijacker")
+	}
+	if _, ok := wrapped.(http.Pusher); ok {
+		t.Fatal("expected wrapped writer not to implement http.Pusher")
+	}
+
+	hijacker.Hijack()
+	if !inner.hijacked {
+		t.Error("expected Hijack to be delegated to the underlying ResponseWriter")
+	}
+}
+
+func TestWrapResponseWriterPreservesFlusher(t *testing.T) {
+	inner := httptest.NewRecorder()
+	stats := responseStats{0, 200, false}
+	wrapped := wrapResponseWriter(inner, &stats)
+
+	flusher, ok := wrapped.(http.Flusher)
+	if !ok {
+		t.Fatal("expected wrapped writer to implement http.Flusher")
+	}
+	if _, ok := wrapped.(http.Hijacker); ok {
+		t.Fatal("expected wrapped writer not to implement http.Hijacker")
+	}
+
+	flusher.Flush()
+	if !inner.Flushed {
+		t.Error("expected Flush to be delegated to the underlying ResponseWriter")
+	}
+}
+
+func TestWrapResponseWriterPlainWriter(t *testing.T) {
+	inner := httptest.NewRecorder()
+	stats := responseStats{0, 200, false}
+	wrapped := wrapResponseWriter(blackHole{}, &stats)
+	_ = inner
+
+	if _, ok := wrapped.(http.Hijacker); ok {
+		t.Error("expected plain writer not to implement http.Hijacker")
+	}
+	if _, ok := wrapped.(http.Flusher); ok {
+		t.Error("expected plain writer not to implement http.Flusher")
+	}
+}
+
+func TestWriteAccumulatesBodyBytesAcrossCalls(t *testing.T) {
+	inner := httptest.NewRecorder()
+	stats := responseStats{0, 200, false}
+	wrapped := wrapResponseWriter(inner, &stats)
+
+	wrapped.Write([]byte("hello "))
+	wrapped.Write([]byte("world"))
+
+	if stats.bodyBytes != len("hello world") {
+		t.Errorf("expected bodyBytes to accumulate to %d, got %d", len("hello world"), stats.bodyBytes)
+	}
+}